@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/IMQS/log"
+)
+
+// appliedMigration is a row of schema_migrations, as last recorded for a given version.
+type appliedMigration struct {
+	Direction string
+	Checksum  sql.NullString
+	AppliedAt sql.NullTime
+}
+
+// ensureChecksumColumns adds the 'checksum' and 'applied_at' columns to databases that
+// adopted schema_migrations before checksum verification existed. Existing rows are left
+// with a NULL checksum, since we have no record of what was actually run; they simply
+// fall outside of drift detection until they're next re-applied.
+func ensureChecksumColumns(db *sql.DB) error {
+	exists := false
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'schema_migrations' AND column_name = 'checksum')").Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := db.Exec("ALTER TABLE schema_migrations ADD COLUMN checksum VARCHAR"); err != nil {
+			return err
+		}
+	}
+	exists = false
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'schema_migrations' AND column_name = 'applied_at')").Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := db.Exec("ALTER TABLE schema_migrations ADD COLUMN applied_at TIMESTAMPTZ"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// migrationHasDrifted reports whether the on-disk content of a migration (in the direction
+// it was last applied) no longer matches the checksum recorded when it was applied. A
+// migration with no recorded checksum (applied before checksums existed) can't be checked,
+// and is reported as not drifted.
+func migrationHasDrifted(m *migration, am *appliedMigration) bool {
+	if am == nil || !am.Checksum.Valid {
+		return false
+	}
+	content := m.UpSQL
+	if am.Direction == string(dirDown) {
+		content = m.DownSQL
+	}
+	if content == nil {
+		// The file that was applied is no longer available at all; that's drift too.
+		return true
+	}
+	return sha256Hex(content) != am.Checksum.String
+}
+
+// checkDrift fails loudly if any already-applied migration's on-disk content no longer
+// matches what was recorded when it was applied, unless allowDrift is set, in which case
+// it logs the drift and continues.
+func checkDrift(log *log.Logger, migrations []*migration, existing map[string]*appliedMigration, allowDrift bool) error {
+	for _, m := range migrations {
+		am := existing[m.Version]
+		if !migrationHasDrifted(m, am) {
+			continue
+		}
+		msg := fmt.Sprintf("Migration %v has changed since it was applied (checksum mismatch)", m.Version)
+		if !allowDrift {
+			return fmt.Errorf("%v. Re-run with --allow-drift to proceed anyway", msg)
+		}
+		log.Errorf("%v (continuing because --allow-drift was given)", msg)
+	}
+	return nil
+}
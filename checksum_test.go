@@ -0,0 +1,56 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/IMQS/log"
+)
+
+func testLogger(t *testing.T) *log.Logger {
+	return log.New(filepath.Join(t.TempDir(), "test.log"), false)
+}
+
+func TestMigrationHasDrifted(t *testing.T) {
+	up := []byte("CREATE TABLE foo (id integer);")
+	m := &migration{Version: "0001-initial", UpSQL: up}
+
+	cases := []struct {
+		name string
+		am   *appliedMigration
+		want bool
+	}{
+		{"never applied", nil, false},
+		{"applied, no checksum recorded (pre-checksum migration)", &appliedMigration{Direction: string(dirUp)}, false},
+		{"applied, checksum matches", &appliedMigration{Direction: string(dirUp), Checksum: sql.NullString{String: sha256Hex(up), Valid: true}}, false},
+		{"applied, checksum mismatch", &appliedMigration{Direction: string(dirUp), Checksum: sql.NullString{String: "deadbeef", Valid: true}}, true},
+		{"applied, up file removed since", &appliedMigration{Direction: string(dirUp), Checksum: sql.NullString{String: sha256Hex(up), Valid: true}}, true},
+	}
+
+	for i, c := range cases {
+		mig := m
+		if c.name == "applied, up file removed since" {
+			mig = &migration{Version: "0001-initial"}
+		}
+		if got := migrationHasDrifted(mig, c.am); got != c.want {
+			t.Errorf("case %v (%v): migrationHasDrifted() = %v, want %v", i, c.name, got, c.want)
+		}
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	up := []byte("CREATE TABLE foo (id integer);")
+	migrations := []*migration{{Version: "0001-initial", UpSQL: up}}
+	existing := map[string]*appliedMigration{
+		"0001-initial": {Direction: string(dirUp), Checksum: sql.NullString{String: "deadbeef", Valid: true}},
+	}
+
+	logger := testLogger(t)
+	if err := checkDrift(logger, migrations, existing, false); err == nil {
+		t.Errorf("expected checkDrift to fail on drifted migration when allowDrift is false")
+	}
+	if err := checkDrift(logger, migrations, existing, true); err != nil {
+		t.Errorf("expected checkDrift to tolerate drift when allowDrift is true, got %v", err)
+	}
+}
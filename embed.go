@@ -0,0 +1,11 @@
+package main
+
+import "embed"
+
+// embeddedMigrations is the binary's built-in copy of dbschema/migrations, used by
+// embedSource (see source.go) when a migrations location is given as "embed://<dbname>".
+// In the docker build, dbschema/migrations is populated with the real per-database
+// migration files before this binary is compiled.
+//
+//go:embed dbschema/migrations
+var embeddedMigrations embed.FS
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migration is a schema change authored in Go rather than SQL, for logic that plain SQL
+// can't express (eg parsing JSON out of a column, or geocoding addresses). It's registered
+// by calling RegisterMigration, typically from an init() function in the file that defines
+// Up and Down, so that it's picked up automatically without any change to main().
+type Migration struct {
+	// DB is the database this migration belongs to (eg "main"), matching the directory name
+	// (or embed:// name) that 'migrator' is pointed at for that database. A single process
+	// manages many databases at once (see upgradeAll), so this is what keeps a migration
+	// from being merged into, and run against, every database instead of just its own.
+	DB string
+	// Name is the migration's ordering key, in the same filename-style format as SQL
+	// migrations (eg "2024-05-01-backfill-assets"). It must not collide with the name of
+	// an on-disk SQL migration for the same database.
+	Name string
+	Up   func(*sql.Tx) error
+	Down func(*sql.Tx) error // optional; omit if this migration cannot be reversed
+}
+
+// registeredMigrations holds every Migration registered via RegisterMigration, keyed first
+// by DB and then by Name. discoverMigrations merges these in alongside whatever SQL files it
+// finds on disk, scoped to the single database it was asked to scan.
+var registeredMigrations = map[string]map[string]Migration{}
+
+// RegisterMigration adds a Go-coded migration to the set that 'up', 'down', 'goto', 'status'
+// and 'upgrade' merge in alongside migrations discovered on disk for m.DB, keyed by Name. It
+// panics if DB or Name is empty, or on a duplicate (DB, Name) pair, since those can only be
+// programming errors.
+func RegisterMigration(m Migration) {
+	if m.DB == "" {
+		panic(fmt.Sprintf("Migration %v must set DB, so that it only runs against the database it belongs to", m.Name))
+	}
+	if m.Name == "" {
+		panic(fmt.Sprintf("Migration for database %v must set Name", m.DB))
+	}
+	if registeredMigrations[m.DB] == nil {
+		registeredMigrations[m.DB] = map[string]Migration{}
+	}
+	if _, exists := registeredMigrations[m.DB][m.Name]; exists {
+		panic(fmt.Sprintf("Migration %v is already registered for database %v", m.Name, m.DB))
+	}
+	registeredMigrations[m.DB][m.Name] = m
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+)
+
+func noopUp(*sql.Tx) error { return nil }
+
+// registerTestMigration registers a Migration and unregisters it when the test ends, so that
+// test registrations don't leak into other tests sharing the registeredMigrations map.
+func registerTestMigration(t *testing.T, m Migration) {
+	RegisterMigration(m)
+	t.Cleanup(func() {
+		delete(registeredMigrations[m.DB], m.Name)
+	})
+}
+
+// A Migration registered for one database must not be merged into another database's
+// migration list, even though registeredMigrations is one process-wide map.
+func TestDiscoverMigrationsScopesGoMigrationsToTheirDB(t *testing.T) {
+	registerTestMigration(t, Migration{DB: "main", Name: "2024-05-01-backfill-assets", Up: noopUp})
+	registerTestMigration(t, Migration{DB: "mirror", Name: "2024-06-01-backfill-other", Up: noopUp})
+
+	mainSrc := &mapSource{db: "main", fsys: fstest.MapFS{
+		"0001-initial.up.sql": {Data: []byte("CREATE TABLE foo (id integer);")},
+	}}
+	migrations, err := discoverMigrations(mainSrc)
+	if err != nil {
+		t.Fatalf("discoverMigrations: %v", err)
+	}
+
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.Version)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("expected 2 migrations (1 SQL + 1 Go, scoped to 'main'), got %v", names)
+	}
+	for _, m := range migrations {
+		if m.Version == "2024-06-01-backfill-other" {
+			t.Errorf("migration registered for 'mirror' must not be merged into 'main', got %v", names)
+		}
+		if m.Version == "2024-05-01-backfill-assets" && m.GoUp == nil {
+			t.Errorf("expected the 'main' Go migration to carry its Up closure")
+		}
+	}
+}
+
+// A Go migration's Name must not collide with an on-disk SQL migration for the same DB.
+func TestDiscoverMigrationsRejectsDuplicateNameBetweenSQLAndGo(t *testing.T) {
+	registerTestMigration(t, Migration{DB: "main", Name: "0001-initial", Up: noopUp})
+
+	src := &mapSource{db: "main", fsys: fstest.MapFS{
+		"0001-initial.up.sql": {Data: []byte("CREATE TABLE foo (id integer);")},
+	}}
+	if _, err := discoverMigrations(src); err == nil {
+		t.Fatalf("expected an error when a Go migration's name collides with an on-disk SQL migration")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/IMQS/log"
+)
+
+// ErrLockHeld is returned by acquireMigrationLock when nowait is true and another
+// process already holds the advisory lock for this database.
+var ErrLockHeld = errors.New("Migration lock is already held by another process")
+
+// migrationLock wraps a single *sql.Conn pinned for the lifetime of a Postgres session-level
+// advisory lock, so that the unlock call is guaranteed to run on the same backend that took
+// the lock (advisory locks are released automatically if the session that holds them drops,
+// but pg_advisory_unlock must be issued from that same session to release it explicitly).
+type migrationLock struct {
+	conn   *sql.Conn
+	dbname string
+}
+
+// acquireMigrationLock takes a Postgres session-level advisory lock keyed on the database
+// name, so that two concurrent migrator instances can't race on the same schema_migrations
+// table. If nowait is true and the lock is already held, it returns ErrLockHeld immediately
+// instead of blocking.
+func acquireMigrationLock(log *log.Logger, db *sql.DB, dbname string, nowait bool) (*migrationLock, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if nowait {
+		acquired := false
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext('migrator:' || $1))", dbname).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if !acquired {
+			conn.Close()
+			return nil, ErrLockHeld
+		}
+	} else {
+		log.Debugf("Acquiring migration lock for %v", dbname)
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext('migrator:' || $1))", dbname); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return &migrationLock{conn: conn, dbname: dbname}, nil
+}
+
+// release unlocks the advisory lock and closes the pinned connection. It's a no-op if l is
+// nil, so callers can defer it unconditionally after a failed acquire.
+func (l *migrationLock) release(log *log.Logger) {
+	if l == nil {
+		return
+	}
+	ctx := context.Background()
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext('migrator:' || $1))", l.dbname); err != nil {
+		log.Errorf("Failed to release migration lock for %v: %v", l.dbname, err)
+	}
+	l.conn.Close()
+}
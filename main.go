@@ -30,12 +30,17 @@ vgo build && ./migrator logs postgres:localhost:0:newdb:unit_test_user:unit_test
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -44,12 +49,33 @@ import (
 	_ "github.com/lib/pq"
 )
 
-const metaTableCreateStatement = "CREATE TABLE schema_migrations (version VARCHAR PRIMARY KEY);"
+const metaTableCreateStatement = "CREATE TABLE schema_migrations (version VARCHAR PRIMARY KEY, direction VARCHAR NOT NULL DEFAULT 'up', checksum VARCHAR, applied_at TIMESTAMPTZ);"
 const migrationsRoot = "/dbschema/migrations" // This path is controlled by https://github.com/IMQS/migrations/blob/master/Dockerfile
 
 var validDBNameRegex = regexp.MustCompile(`^[_\-a-zA-Z0-9]+$`)
 var validSchemaNameRegex = regexp.MustCompile(`^[_\-a-zA-Z0-9]+$`)
 
+// direction indicates which way a migration is being applied
+type direction string
+
+const (
+	dirUp   direction = "up"
+	dirDown direction = "down"
+)
+
+// migration is a single named schema change. It may have up SQL, down SQL, or both, or
+// (if it was registered via RegisterMigration) Go closures in place of either. Legacy
+// migrations (the old Albion-era '0000-*.sql' files, and the date-prefixed files that
+// came after them) only ever run 'up' and have no down counterpart.
+type migration struct {
+	Version string // eg "0001-initial", or "2018-05-01-add-widgets"
+	UpSQL   []byte
+	DownSQL []byte // nil if this migration cannot be reversed
+	GoUp    func(*sql.Tx) error // set instead of UpSQL for a Go-coded migration
+	GoDown  func(*sql.Tx) error // set instead of DownSQL for a Go-coded migration
+	Legacy  bool
+}
+
 type dbCon struct {
 	driver   string
 	host     string
@@ -80,6 +106,11 @@ func (c *dbCon) string() string {
 	return c.host + ":" + c.dbname
 }
 
+// dbStr re-renders this connection as the colon-separated string that parseDBConStr accepts.
+func (c *dbCon) dbStr() string {
+	return fmt.Sprintf("%v:%v:%v:%v:%v:%v", c.driver, c.host, c.port, c.dbname, c.user, c.password)
+}
+
 // postgres:hostname:port:dbname:username:password
 // port and password may be blank, in which case they are omitted from the connection string
 // Returns driver, con, error
@@ -148,7 +179,7 @@ func connectOrCreate(log *log.Logger, con dbCon) (*sql.DB, error) {
 
 // Detect the presence of the old Albion-based migration system, and take over from that.
 // Also support initializing a fresh database.
-func bootstrap(log *log.Logger, dbName string, db *sql.DB, sqlFiles []string) error {
+func bootstrap(log *log.Logger, dbName string, db *sql.DB, migrations []*migration) error {
 	// Detect the state of this database
 	vertype := ""
 	if err := db.QueryRow("SELECT data_type FROM information_schema.columns WHERE table_name = 'schema_migrations' AND column_name = 'version'").Scan(&vertype); err != nil {
@@ -159,13 +190,21 @@ func bootstrap(log *log.Logger, dbName string, db *sql.DB, sqlFiles []string) er
 				return err
 			}
 			log.Infof("Running legacy migrations (ie 0000-*.sql)")
-			return runLegacyMigrations(log, db, sqlFiles)
+			return runLegacyMigrations(log, db, migrations)
 		}
 		return fmt.Errorf("Unable to read datatype of schema_migrations.version field: %v", err)
 	}
 
 	if strings.Index(vertype, "char") != -1 {
-		// The database is already using this migration system, so we have no bootstrapping work to do here
+		// The database is already using this migration system, but it may predate the
+		// introduction of the 'direction' column, or the 'checksum'/'applied_at' columns.
+		// Add whichever are missing.
+		if err := ensureDirectionColumn(db); err != nil {
+			return err
+		}
+		if err := ensureChecksumColumns(db); err != nil {
+			return err
+		}
 		return nil
 	}
 
@@ -173,24 +212,43 @@ func bootstrap(log *log.Logger, dbName string, db *sql.DB, sqlFiles []string) er
 	// Switch over to our new system.
 	log.Infof("Switching %v over from Albion migration system", dbName)
 	fmt.Printf("Switching %v over from Albion migration system\n", dbName)
-	return switchoverFromAlbion(log, db, sqlFiles)
+	return switchoverFromAlbion(log, db, migrations)
 }
 
-func getMigrationsInDB(db *sql.DB) (map[string]bool, error) {
-	rows, err := db.Query("SELECT version FROM schema_migrations")
+// ensureDirectionColumn adds the 'direction' column to databases that adopted
+// schema_migrations before down-migrations existed. Every pre-existing row is
+// assumed to have been applied 'up', since there was no other way to apply
+// a migration back then, and no down file can possibly be known for it.
+func ensureDirectionColumn(db *sql.DB) error {
+	exists := false
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'schema_migrations' AND column_name = 'direction')").Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err := db.Exec("ALTER TABLE schema_migrations ADD COLUMN direction VARCHAR NOT NULL DEFAULT 'up'")
+	return err
+}
+
+// getMigrationsInDB returns, for every version recorded in schema_migrations, the
+// direction it was last applied in ("up" or "down"), along with its checksum and
+// applied_at bookkeeping.
+func getMigrationsInDB(db *sql.DB) (map[string]*appliedMigration, error) {
+	rows, err := db.Query("SELECT version, direction, checksum, applied_at FROM schema_migrations")
 	if err != nil {
 		return nil, err
 	}
-	versions := map[string]bool{}
 	defer rows.Close()
+	versions := map[string]*appliedMigration{}
 	for rows.Next() {
+		am := &appliedMigration{}
 		version := ""
-		if err := rows.Scan(&version); err != nil {
+		if err := rows.Scan(&version, &am.Direction, &am.Checksum, &am.AppliedAt); err != nil {
 			return nil, err
 		}
-		versions[version] = true
+		versions[version] = am
 	}
-	rows.Close()
 	return versions, nil
 }
 
@@ -198,10 +256,10 @@ func getMigrationsInDB(db *sql.DB) (map[string]bool, error) {
 // we switched over to this new migration system. For example, for the IMQS 'main' database, we switched
 // over from the Albion-based migration system, to this system, somewhere around version 160.
 // This function is here to bring a fresh database up to that "160" state.
-func runLegacyMigrations(log *log.Logger, db *sql.DB, sqlFiles []string) error {
-	for _, file := range sqlFiles {
-		if _, isLegacy := legacyMigrationVersion(file); isLegacy {
-			if err := runMigration(log, db, file); err != nil {
+func runLegacyMigrations(log *log.Logger, db *sql.DB, migrations []*migration) error {
+	for _, m := range migrations {
+		if _, isLegacy := legacyMigrationVersion(m.Version); isLegacy {
+			if err := runMigration(log, db, m, dirUp); err != nil {
 				return err
 			}
 		}
@@ -215,10 +273,10 @@ func runLegacyMigrations(log *log.Logger, db *sql.DB, sqlFiles []string) error {
 // 0000-0057.sql
 // -------------> returns 57
 // If there are no legacy migrations, returns zero
-func maxLegacyMigrationVersion(sqlFiles []string) int {
+func maxLegacyMigrationVersion(migrations []*migration) int {
 	m := 0
-	for _, file := range sqlFiles {
-		if v, isLegacy := legacyMigrationVersion(file); isLegacy {
+	for _, mig := range migrations {
+		if v, isLegacy := legacyMigrationVersion(mig.Version); isLegacy {
 			if v > m {
 				m = v
 			}
@@ -227,11 +285,9 @@ func maxLegacyMigrationVersion(sqlFiles []string) int {
 	return m
 }
 
-// Reads a migration filename, and interprets it as a legacy migration version
-func legacyMigrationVersion(sqlfile string) (version int, isLegacy bool) {
-	s := filepath.Base(sqlfile)
-	s = s[:len(s)-4]
-	parts := strings.Split(s, "-")
+// Reads a migration name, and interprets it as a legacy migration version
+func legacyMigrationVersion(version string) (int, bool) {
+	parts := strings.Split(version, "-")
 	if len(parts) != 2 || parts[0] != "0000" || len(parts[1]) == 0 {
 		return 0, false
 	}
@@ -239,13 +295,13 @@ func legacyMigrationVersion(sqlfile string) (version int, isLegacy bool) {
 	return int(v), true
 }
 
-func switchoverFromAlbion(log *log.Logger, db *sql.DB, sqlFiles []string) error {
+func switchoverFromAlbion(log *log.Logger, db *sql.DB, migrations []*migration) error {
 	// Make sure the database has been fully migrated on the Albion system, before taking control.
 	maxDB := 0
 	if err := db.QueryRow("SELECT max(version) FROM schema_migrations").Scan(&maxDB); err != nil {
 		return fmt.Errorf("Unable to read max legacy version: %v", err)
 	}
-	maxAvailable := maxLegacyMigrationVersion(sqlFiles)
+	maxAvailable := maxLegacyMigrationVersion(migrations)
 	if maxDB != maxAvailable {
 		return fmt.Errorf("Unable to upgrade migration system. Expected database to be at migration %v, but it is at %v", maxAvailable, maxDB)
 	}
@@ -262,13 +318,12 @@ func switchoverFromAlbion(log *log.Logger, db *sql.DB, sqlFiles []string) error
 		return err
 	}
 	log.Info("Inserting legacy migrations into schema_migrations (without running them)")
-	for _, file := range sqlFiles {
-		if _, isLegacy := legacyMigrationVersion(file); isLegacy {
-			if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", migrationNameFromFile(file)); err != nil {
+	for _, m := range migrations {
+		if _, isLegacy := legacyMigrationVersion(m.Version); isLegacy {
+			if _, err := tx.Exec("INSERT INTO schema_migrations (version, direction) VALUES ($1, 'up')", m.Version); err != nil {
 				tx.Rollback()
 				return err
 			}
-
 		}
 	}
 	if err := tx.Commit(); err != nil {
@@ -278,36 +333,91 @@ func switchoverFromAlbion(log *log.Logger, db *sql.DB, sqlFiles []string) error
 	return nil
 }
 
-func migrationNameFromFile(filename string) string {
-	name := filepath.Base(filename) // remove directory name
-	name = name[0 : len(name)-4]    // remove .sql
-	return strings.ToLower(name)
+// classifyMigrationFile interprets a migration filename, and returns the name that
+// identifies the migration (shared between its up and down files), which direction
+// this particular file runs, and whether it's one of the legacy (up-only) files that
+// predate the .up.sql/.down.sql naming convention (ie '0000-*.sql' and the
+// date-prefixed files that followed it).
+func classifyMigrationFile(filename string) (name string, dir direction, legacy bool) {
+	base := strings.ToLower(filepath.Base(filename))
+	switch {
+	case strings.HasSuffix(base, ".up.sql"):
+		return strings.TrimSuffix(base, ".up.sql"), dirUp, false
+	case strings.HasSuffix(base, ".down.sql"):
+		return strings.TrimSuffix(base, ".down.sql"), dirDown, false
+	default:
+		return strings.TrimSuffix(base, ".sql"), dirUp, true
+	}
 }
 
-func runMigration(log *log.Logger, db *sql.DB, sqlFile string) error {
-	sql, err := ioutil.ReadFile(sqlFile)
-	if err != nil {
-		return fmt.Errorf("Error reading migration file %v: %v", sqlFile, err)
-	}
+// runMigration applies a single migration, in a single transaction, and records it in
+// schema_migrations. It dispatches to the migration's Go closure if it has one (GoUp/GoDown),
+// or otherwise executes its SQL. Go migrations have no file content to checksum, so they're
+// recorded with a NULL checksum, the same as migrations applied before checksums existed.
+func runMigration(log *log.Logger, db *sql.DB, m *migration, dir direction) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	migname := migrationNameFromFile(sqlFile)
-	log.Infof("Running migration %v", migname)
-	fmt.Printf("Running migration %v\n", migname)
-	if _, err := tx.Exec(string(sql)); err != nil {
+	log.Infof("Running migration %v (%v)", m.Version, dir)
+	fmt.Printf("Running migration %v (%v)\n", m.Version, dir)
+
+	var checksum sql.NullString
+	switch {
+	case dir == dirDown && m.GoDown != nil:
+		if err := m.GoDown(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	case dir == dirDown && m.DownSQL != nil:
+		if _, err := tx.Exec(string(m.DownSQL)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		checksum = sql.NullString{String: sha256Hex(m.DownSQL), Valid: true}
+	case dir == dirDown:
 		tx.Rollback()
-		return err
+		return fmt.Errorf("No down migration available for %v", m.Version)
+	case m.GoUp != nil:
+		if err := m.GoUp(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	case m.UpSQL != nil:
+		if _, err := tx.Exec(string(m.UpSQL)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		checksum = sql.NullString{String: sha256Hex(m.UpSQL), Valid: true}
+	default:
+		tx.Rollback()
+		return fmt.Errorf("No up migration available for %v", m.Version)
 	}
-	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", migname); err != nil {
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, direction, checksum, applied_at) VALUES ($1, $2, $3, now()) "+
+		"ON CONFLICT (version) DO UPDATE SET direction = EXCLUDED.direction, checksum = EXCLUDED.checksum, applied_at = EXCLUDED.applied_at",
+		m.Version, string(dir), checksum); err != nil {
 		tx.Rollback()
 		return err
 	}
 	return tx.Commit()
 }
 
-func runMigrations(log *log.Logger, dbStr string, sqlFiles []string) error {
+// runMigrations applies up to 'steps' migrations in the given direction. A steps value
+// of 0 means "no limit", but only for dirUp: running 'down' with no limit would revert
+// the entire database, which is not what a caller passing steps=0 (or omitting it over
+// HTTP) would expect, so for dirDown a steps of 0 is a no-op instead. A negative steps is
+// rejected outright, rather than falling through to the "no limit" behavior of the loop
+// below (which only stops early when steps > 0), since callers should already have
+// validated this; it's checked again here as a backstop.
+func runMigrations(log *log.Logger, dbStr string, migrations []*migration, dir direction, steps int, nowait bool, allowDrift bool) error {
+	if steps < 0 {
+		return fmt.Errorf("Invalid step count %v: must not be negative", steps)
+	}
+	if dir == dirDown && steps == 0 {
+		fmt.Printf("steps=0 requested for down-migration; nothing to do\n")
+		return nil
+	}
 	con, err := parseDBConStr(dbStr)
 	if err != nil {
 		return err
@@ -319,7 +429,13 @@ func runMigrations(log *log.Logger, dbStr string, sqlFiles []string) error {
 	}
 	defer db.Close()
 
-	if err := bootstrap(log, con.dbname, db, sqlFiles); err != nil {
+	lock, err := acquireMigrationLock(log, db, con.dbname, nowait)
+	if err != nil {
+		return err
+	}
+	defer lock.release(log)
+
+	if err := bootstrap(log, con.dbname, db, migrations); err != nil {
 		return err
 	}
 
@@ -327,14 +443,37 @@ func runMigrations(log *log.Logger, dbStr string, sqlFiles []string) error {
 	if err != nil {
 		return err
 	}
+	if err := checkDrift(log, migrations, existing, allowDrift); err != nil {
+		return err
+	}
+
 	nrun := 0
-	for _, file := range sqlFiles {
-		migname := migrationNameFromFile(file)
-		if !existing[migname] {
+	if dir == dirUp {
+		for _, m := range migrations {
+			if applied(existing, m.Version) {
+				continue
+			}
+			if err := runMigration(log, db, m, dirUp); err != nil {
+				return err
+			}
 			nrun++
-			if err := runMigration(log, db, file); err != nil {
+			if steps > 0 && nrun >= steps {
+				break
+			}
+		}
+	} else {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if !applied(existing, m.Version) {
+				continue
+			}
+			if err := runMigration(log, db, m, dirDown); err != nil {
 				return err
 			}
+			nrun++
+			if steps > 0 && nrun >= steps {
+				break
+			}
 		}
 	}
 	if nrun == 0 {
@@ -343,6 +482,161 @@ func runMigrations(log *log.Logger, dbStr string, sqlFiles []string) error {
 	return nil
 }
 
+func applied(existing map[string]*appliedMigration, version string) bool {
+	am := existing[version]
+	return am != nil && am.Direction == string(dirUp)
+}
+
+// gotoVersion migrates a database up or down until 'target' is the most recently
+// applied migration.
+func gotoVersion(log *log.Logger, dbStr string, migrations []*migration, target string, nowait bool, allowDrift bool) error {
+	con, err := parseDBConStr(dbStr)
+	if err != nil {
+		return err
+	}
+	db, err := connectOrCreate(log, con)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	lock, err := acquireMigrationLock(log, db, con.dbname, nowait)
+	if err != nil {
+		return err
+	}
+	defer lock.release(log)
+
+	if err := bootstrap(log, con.dbname, db, migrations); err != nil {
+		return err
+	}
+
+	targetIndex := -1
+	for i, m := range migrations {
+		if m.Version == target {
+			targetIndex = i
+			break
+		}
+	}
+	if targetIndex == -1 {
+		return fmt.Errorf("Unknown migration version '%v'", target)
+	}
+
+	existing, err := getMigrationsInDB(db)
+	if err != nil {
+		return err
+	}
+	if err := checkDrift(log, migrations, existing, allowDrift); err != nil {
+		return err
+	}
+	currentIndex := -1
+	for i, m := range migrations {
+		if applied(existing, m.Version) {
+			currentIndex = i
+		}
+	}
+
+	// The applied set isn't guaranteed to be a contiguous prefix of migrations: a Go
+	// migration (or any migration) can be registered with a sort-key that places it
+	// earlier than one that's already applied. So rather than trusting currentIndex as a
+	// boundary, mirror runMigrations: scan the whole relevant range and skip (up) or
+	// require-applied (down) each migration individually.
+	nrun := 0
+	if targetIndex >= currentIndex {
+		for i := 0; i <= targetIndex; i++ {
+			if applied(existing, migrations[i].Version) {
+				continue
+			}
+			if err := runMigration(log, db, migrations[i], dirUp); err != nil {
+				return err
+			}
+			nrun++
+		}
+	} else {
+		for i := len(migrations) - 1; i > targetIndex; i-- {
+			if !applied(existing, migrations[i].Version) {
+				continue
+			}
+			if err := runMigration(log, db, migrations[i], dirDown); err != nil {
+				return err
+			}
+			nrun++
+		}
+	}
+	if nrun == 0 {
+		fmt.Printf("Database is already at %v\n", target)
+	}
+	return nil
+}
+
+// statusEntry describes the state of a single migration, for 'migrator status' and
+// the equivalent HTTP endpoint.
+type statusEntry struct {
+	Version   string `json:"version"`
+	Applied   bool   `json:"applied"`
+	Direction string `json:"direction"`
+	HasDown   bool   `json:"hasDown"`
+	Checksum  string `json:"checksum"`
+	AppliedAt string `json:"appliedAt"`
+	Drifted   bool   `json:"drifted"`
+}
+
+func status(log *log.Logger, dbStr string, migrations []*migration) ([]statusEntry, error) {
+	con, err := parseDBConStr(dbStr)
+	if err != nil {
+		return nil, err
+	}
+	db, err := connectOrCreate(log, con)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// bootstrap can issue DDL (CREATE TABLE/ALTER TABLE) on a fresh database, so it needs
+	// the same advisory lock as runMigrations/gotoVersion to avoid racing a concurrent
+	// 'status' (or 'up'/'down'/'goto') against the same new database.
+	lock, err := acquireMigrationLock(log, db, con.dbname, false)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release(log)
+
+	if err := bootstrap(log, con.dbname, db, migrations); err != nil {
+		return nil, err
+	}
+
+	existing, err := getMigrationsInDB(db)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]statusEntry, len(migrations))
+	for i, m := range migrations {
+		am := existing[m.Version]
+		e := statusEntry{
+			Version: m.Version,
+			HasDown: m.DownSQL != nil || m.GoDown != nil,
+		}
+		if am != nil {
+			e.Applied = am.Direction == string(dirUp)
+			e.Direction = am.Direction
+			e.Checksum = am.Checksum.String
+			if am.AppliedAt.Valid {
+				e.AppliedAt = am.AppliedAt.Time.Format(time.RFC3339)
+			}
+			e.Drifted = migrationHasDrifted(m, am)
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // Ask the config service for a db connection string
 func getDBConnection(db string) (string, error) {
 	resp, err := http.DefaultClient.Get("http://config/config-service/dbconnection/" + db)
@@ -364,64 +658,205 @@ func upgradeCmd(args []string) error {
 	if len(args) != 3 {
 		return fmt.Errorf("upgrade expected 3 arguments, but %v given", len(args))
 	}
-	logfile := args[0]
-	db := args[1]
-	sqlDir := args[2]
-	return upgrade(logfile, db, sqlDir)
+	return upgrade(args[0], args[1], args[2])
 }
 
-func upgrade(logfile, db, sqlDir string) error {
-	logger := log.New(logfile, true)
-	//logger.Level = log.Debug
-	sqlFiles := []string{}
-	err := filepath.Walk(sqlDir, func(path string, info os.FileInfo, err error) error {
+// extractAllowDriftFlag removes the first "--allow-drift" flag from args, wherever it
+// appears, and reports whether it was found.
+func extractAllowDriftFlag(args []string) ([]string, bool) {
+	for i, a := range args {
+		if a == "--allow-drift" {
+			return append(args[:i:i], args[i+1:]...), true
+		}
+	}
+	return args, false
+}
+
+func upCmd(args []string) error {
+	args, allowDrift := extractAllowDriftFlag(args)
+	if len(args) != 3 && len(args) != 4 {
+		return fmt.Errorf("up expected 3 or 4 arguments (logfile, db, sqlDir, [N]), but %v given", len(args))
+	}
+	steps := 0
+	if len(args) == 4 {
+		n, err := strconv.Atoi(args[3])
 		if err != nil {
-			return fmt.Errorf("Error scanning SQL files: %v", err)
+			return fmt.Errorf("Invalid step count '%v': %v", args[3], err)
+		}
+		if n < 0 {
+			return fmt.Errorf("Invalid step count '%v': must not be negative", args[3])
 		}
-		if filepath.Ext(path) == ".sql" {
-			sqlFiles = append(sqlFiles, path)
+		steps = n
+	}
+	return upSteps(args[0], args[1], args[2], steps, false, allowDrift)
+}
+
+func downCmd(args []string) error {
+	args, allowDrift := extractAllowDriftFlag(args)
+	if len(args) != 3 && len(args) != 4 {
+		return fmt.Errorf("down expected 3 or 4 arguments (logfile, db, sqlDir, [N]), but %v given", len(args))
+	}
+	steps := 1
+	if len(args) == 4 {
+		n, err := strconv.Atoi(args[3])
+		if err != nil {
+			return fmt.Errorf("Invalid step count '%v': %v", args[3], err)
 		}
-		if info.IsDir() && path != sqlDir {
-			return filepath.SkipDir
+		if n < 0 {
+			return fmt.Errorf("Invalid step count '%v': must not be negative", args[3])
 		}
-		return nil
-	})
+		steps = n
+	}
+	return downSteps(args[0], args[1], args[2], steps, false, allowDrift)
+}
+
+func gotoCmd(args []string) error {
+	args, allowDrift := extractAllowDriftFlag(args)
+	if len(args) != 4 {
+		return fmt.Errorf("goto expected 4 arguments (logfile, db, sqlDir, version), but %v given", len(args))
+	}
+	logger := log.New(args[0], true)
+	migrations, err := discoverMigrationsAt(args[2])
 	if err != nil {
-		return fmt.Errorf("Error scanning %v: %v", sqlDir, err)
+		return err
 	}
-	if len(sqlFiles) == 0 {
-		return fmt.Errorf("No SQL files found in %v", sqlDir)
+	return gotoVersion(logger, args[1], migrations, args[3], false, allowDrift)
+}
+
+func statusCmd(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("status expected 3 arguments (logfile, db, sqlDir), but %v given", len(args))
+	}
+	logger := log.New(args[0], true)
+	migrations, err := discoverMigrationsAt(args[2])
+	if err != nil {
+		return err
 	}
-	err = runMigrations(logger, db, sqlFiles)
+	entries, err := status(logger, args[1], migrations)
 	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		appliedLabel := "pending"
+		if e.Applied {
+			appliedLabel = "applied"
+		}
+		hasDown := "no down"
+		if e.HasDown {
+			hasDown = "has down"
+		}
+		drift := ""
+		if e.Drifted {
+			drift = " DRIFTED"
+		}
+		fmt.Printf("%-40v %-10v %v%v\n", e.Version, appliedLabel, hasDown, drift)
+	}
+	return nil
+}
+
+// upgrade brings a database all the way up to the latest available migration.
+// It is the original entry point used by the 'upgrade' command, and is kept around
+// (in preference to always calling upSteps directly) because it's also what
+// upgradeAll calls into. The HTTP '/upgrade/' handler calls upSteps itself, so that it
+// can pass through its nowait and allow-drift query params.
+func upgrade(logfile, db, sqlDir string) error {
+	return upSteps(logfile, db, sqlDir, 0, false, false)
+}
+
+func upSteps(logfile, db, sqlDir string, steps int, nowait bool, allowDrift bool) error {
+	logger := log.New(logfile, true)
+	migrations, err := discoverMigrationsAt(sqlDir)
+	if err != nil {
+		return err
+	}
+	if err := runMigrations(logger, db, migrations, dirUp, steps, nowait, allowDrift); err != nil {
 		con, _ := parseDBConStr(db)
 		logger.Errorf("%v: %v", con.dbname, err)
-		return fmt.Errorf("%v: %v", con.dbname, err)
+		return fmt.Errorf("%v: %w", con.dbname, err)
 	}
 	return nil
 }
 
-func upgradeAll(logfile string) error {
-	//iterate over the folders in the migration root
-	files, err := ioutil.ReadDir(migrationsRoot)
+func downSteps(logfile, db, sqlDir string, steps int, nowait bool, allowDrift bool) error {
+	logger := log.New(logfile, true)
+	migrations, err := discoverMigrationsAt(sqlDir)
 	if err != nil {
 		return err
 	}
-	for _, f := range files {
-		if f.IsDir() {
-			conn, err := getDBConnection(f.Name())
-			if err != nil {
-				return err
+	if err := runMigrations(logger, db, migrations, dirDown, steps, nowait, allowDrift); err != nil {
+		con, _ := parseDBConStr(db)
+		logger.Errorf("%v: %v", con.dbname, err)
+		return fmt.Errorf("%v: %w", con.dbname, err)
+	}
+	return nil
+}
+
+// migrationsLocationFor resolves the migrations source for a single database: the
+// docker-mounted directory under migrationsRoot, if it's present, and otherwise the
+// binary's own embedded copy (see embed.go). This is what lets 'migrator' keep servicing
+// databases even when migrationsRoot hasn't been mounted into the container.
+func migrationsLocationFor(dbName string) string {
+	if _, err := os.Stat(filepath.Join(migrationsRoot, dbName)); err == nil {
+		return filepath.Join(migrationsRoot, dbName)
+	}
+	return "embed://" + dbName
+}
+
+// hasMigrationsFor reports whether a database has migrations available, either mounted on
+// disk under migrationsRoot or embedded in the binary.
+func hasMigrationsFor(dbName string) bool {
+	if _, err := os.Stat(filepath.Join(migrationsRoot, dbName)); err == nil {
+		return true
+	}
+	fi, err := fs.Stat(embeddedMigrations, path.Join("dbschema/migrations", dbName))
+	return err == nil && fi.IsDir()
+}
+
+// discoverDBNames lists every database that has migrations available, either mounted on
+// disk under migrationsRoot or embedded in the binary (see embed.go).
+func discoverDBNames() ([]string, error) {
+	names := map[string]bool{}
+	if files, err := ioutil.ReadDir(migrationsRoot); err == nil {
+		for _, f := range files {
+			if f.IsDir() {
+				names[f.Name()] = true
 			}
-			migrationsDir := filepath.Join(migrationsRoot, f.Name())
-			if err := upgrade(logfile, conn, migrationsDir); err != nil {
-				return err
+		}
+	}
+	if entries, err := fs.ReadDir(embeddedMigrations, "dbschema/migrations"); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				names[e.Name()] = true
 			}
 		}
 	}
-	return nil
+	if len(names) == 0 {
+		return nil, fmt.Errorf("No migrations found under %v or embedded in the binary", migrationsRoot)
+	}
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
 }
 
+func upgradeAll(logfile string) error {
+	dbNames, err := discoverDBNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range dbNames {
+		conn, err := getDBConnection(name)
+		if err != nil {
+			return err
+		}
+		if err := upgrade(logfile, conn, migrationsLocationFor(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
 // This only has to run in docker. On Windows, migrations are run from the shell
 // WARNING. There is no security check here. The implicit security model here is that
@@ -460,18 +895,118 @@ func serviceCmd(args []string) error {
 			http.Error(w, fmt.Sprintf("Failed to fetch db connection for %v: %v", dbName, err), http.StatusBadRequest)
 			return
 		}
-		migrationsDir := filepath.Join(migrationsRoot, dbName)
-		if _, err := os.Stat(migrationsDir); err != nil {
+		if !hasMigrationsFor(dbName) {
 			http.Error(w, fmt.Sprintf("No migrations found for database '%v'", dbName), http.StatusBadRequest)
 			return
 		}
-		if err := upgrade(logfile, dbCon, migrationsDir); err != nil {
+		nowait := r.URL.Query().Get("nowait") == "1"
+		allowDrift := r.URL.Query().Get("allow-drift") == "1"
+		if err := upSteps(logfile, dbCon, migrationsLocationFor(dbName), 0, nowait, allowDrift); err != nil {
+			if errors.Is(err, ErrLockHeld) {
+				http.Error(w, fmt.Sprintf("Upgrade of %v failed: %v", dbName, err), http.StatusConflict)
+				return
+			}
 			http.Error(w, fmt.Sprintf("Upgrade of %v failed: %v", dbName, err), http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "text/plain")
 		fmt.Fprintf(w, "OK")
 	})
+	http.HandleFunc("/down/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Must use a POST request", http.StatusBadRequest)
+			return
+		}
+		dbName := r.URL.Path[6:]
+		if !validDBNameRegex.MatchString(dbName) {
+			http.Error(w, fmt.Sprintf("Invalid db name '%v'. Must be ASCII only", dbName), http.StatusBadRequest)
+			return
+		}
+		steps := 1
+		if s := r.URL.Query().Get("steps"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid 'steps' query param '%v'", s), http.StatusBadRequest)
+				return
+			}
+			if n < 0 {
+				http.Error(w, fmt.Sprintf("Invalid 'steps' query param '%v': must not be negative", s), http.StatusBadRequest)
+				return
+			}
+			steps = n
+		}
+		nowait := r.URL.Query().Get("nowait") == "1"
+		allowDrift := r.URL.Query().Get("allow-drift") == "1"
+		dbCon, err := getDBConnection(dbName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch db connection for %v: %v", dbName, err), http.StatusBadRequest)
+			return
+		}
+		if !hasMigrationsFor(dbName) {
+			http.Error(w, fmt.Sprintf("No migrations found for database '%v'", dbName), http.StatusBadRequest)
+			return
+		}
+		if err := downSteps(logfile, dbCon, migrationsLocationFor(dbName), steps, nowait, allowDrift); err != nil {
+			if errors.Is(err, ErrLockHeld) {
+				http.Error(w, fmt.Sprintf("Down-migration of %v failed: %v", dbName, err), http.StatusConflict)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Down-migration of %v failed: %v", dbName, err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "OK")
+	})
+	http.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		dbName := r.URL.Path[8:]
+		if !validDBNameRegex.MatchString(dbName) {
+			http.Error(w, fmt.Sprintf("Invalid db name '%v'. Must be ASCII only", dbName), http.StatusBadRequest)
+			return
+		}
+		dbCon, err := getDBConnection(dbName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch db connection for %v: %v", dbName, err), http.StatusBadRequest)
+			return
+		}
+		migrations, err := discoverMigrationsAt(migrationsLocationFor(dbName))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("No migrations found for database '%v'", dbName), http.StatusBadRequest)
+			return
+		}
+		entries, err := status(logger, dbCon, migrations)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Status of %v failed: %v", dbName, err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, entries)
+	})
+	http.HandleFunc("/verify/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Must use a POST request", http.StatusBadRequest)
+			return
+		}
+		dbName := r.URL.Path[8:]
+		if !validDBNameRegex.MatchString(dbName) {
+			http.Error(w, fmt.Sprintf("Invalid db name '%v'. Must be ASCII only", dbName), http.StatusBadRequest)
+			return
+		}
+		dbCon, err := getDBConnection(dbName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch db connection for %v: %v", dbName, err), http.StatusBadRequest)
+			return
+		}
+		migrations, err := discoverMigrationsAt(migrationsLocationFor(dbName))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("No migrations found for database '%v'", dbName), http.StatusBadRequest)
+			return
+		}
+		if err := verify(logger, dbCon, migrations, r.URL.Query().Get("from")); err != nil {
+			http.Error(w, fmt.Sprintf("Verification of %v failed: %v", dbName, err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "OK")
+	})
 	http.HandleFunc("/schema/", func(w http.ResponseWriter, r *http.Request) {
 		// Read a schema file
 		filename := r.URL.Path[8:]
@@ -491,10 +1026,17 @@ func serviceCmd(args []string) error {
 }
 
 func showHelp() {
-	fmt.Printf("migrator [upgrade ... | service ...]\n")
-	fmt.Printf("version 1.0.1\n")
-	fmt.Printf(" upgrade <logfile> <db> <path to sql files>  Migrate a database up to the latest version available\n")
-	fmt.Printf(" serve <port>                                Run as an HTTP service, listening on <port>\n")
+	fmt.Printf("migrator [up ... | down ... | goto ... | status ... | verify ... | upgrade ... | service ...]\n")
+	fmt.Printf("version 1.2.0\n")
+	fmt.Printf(" up <logfile> <db> <path to sql files> [N] [--allow-drift]     Migrate a database up by N migrations, or all the way if N is omitted\n")
+	fmt.Printf(" down <logfile> <db> <path to sql files> [N] [--allow-drift]  Migrate a database down by N migrations (default 1)\n")
+	fmt.Printf(" goto <logfile> <db> <path to sql files> <v> [--allow-drift]  Migrate a database up or down until <v> is the most recently applied migration\n")
+	fmt.Printf(" status <logfile> <db> <path to sql files>          Print the applied/pending state of every migration, flagging any that have drifted\n")
+	fmt.Printf(" verify <logfile> <db> <path to sql files> [--from <v>]  Check that migrating straight to HEAD matches migrating incrementally\n")
+	fmt.Printf(" upgrade <logfile> <db> <path to sql files>         Migrate a database up to the latest version available (alias for 'up' with no N)\n")
+	fmt.Printf(" serve <port>                                       Run as an HTTP service, listening on <port>\n")
+	fmt.Printf("\n")
+	fmt.Printf(" --allow-drift  Proceed even if an already-applied migration's on-disk content no longer matches its recorded checksum\n")
 }
 
 func main() {
@@ -503,19 +1045,29 @@ func main() {
 		os.Exit(1)
 	}
 	cmd := os.Args[1]
-	if cmd == "upgrade" {
-		if err := upgradeCmd(os.Args[2:]); err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(1)
-		}
-	} else if cmd == "serve" {
-		if err := serviceCmd(os.Args[2:]); err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(1)
-		}
-	} else {
+	var err error
+	switch cmd {
+	case "upgrade":
+		err = upgradeCmd(os.Args[2:])
+	case "up":
+		err = upCmd(os.Args[2:])
+	case "down":
+		err = downCmd(os.Args[2:])
+	case "goto":
+		err = gotoCmd(os.Args[2:])
+	case "status":
+		err = statusCmd(os.Args[2:])
+	case "verify":
+		err = verifyCmd(os.Args[2:])
+	case "serve":
+		err = serviceCmd(os.Args[2:])
+	default:
 		fmt.Printf("Unknown command '%v'\n", cmd)
 		showHelp()
 		os.Exit(1)
 	}
+	if err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestClassifyMigrationFile(t *testing.T) {
+	cases := []struct {
+		filename   string
+		wantName   string
+		wantDir    direction
+		wantLegacy bool
+	}{
+		{"0001-initial.up.sql", "0001-initial", dirUp, false},
+		{"0001-initial.down.sql", "0001-initial", dirDown, false},
+		{"2018-05-01-add-widgets.UP.SQL", "2018-05-01-add-widgets", dirUp, false},
+		{"0000-0057.sql", "0000-0057", dirUp, true},
+		{"path/to/0001-initial.up.sql", "0001-initial", dirUp, false},
+	}
+	for _, c := range cases {
+		name, dir, legacy := classifyMigrationFile(c.filename)
+		if name != c.wantName || dir != c.wantDir || legacy != c.wantLegacy {
+			t.Errorf("classifyMigrationFile(%q) = (%v, %v, %v), want (%v, %v, %v)",
+				c.filename, name, dir, legacy, c.wantName, c.wantDir, c.wantLegacy)
+		}
+	}
+}
+
+func TestLegacyMigrationVersion(t *testing.T) {
+	cases := []struct {
+		version      string
+		wantVersion  int
+		wantIsLegacy bool
+	}{
+		{"0000-0057", 57, true},
+		{"0000-0001", 1, true},
+		{"2018-05-01-add-widgets", 0, false},
+		{"0001-initial", 0, false},
+	}
+	for _, c := range cases {
+		v, isLegacy := legacyMigrationVersion(c.version)
+		if v != c.wantVersion || isLegacy != c.wantIsLegacy {
+			t.Errorf("legacyMigrationVersion(%q) = (%v, %v), want (%v, %v)",
+				c.version, v, isLegacy, c.wantVersion, c.wantIsLegacy)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MigrationSource abstracts where migration files come from, so that 'migrator' can run
+// against a directory on disk, the binary's own embedded migrations, or a tarball fetched
+// over HTTP (eg handed out by the config service instead of being docker-mounted).
+type MigrationSource interface {
+	// FS returns a filesystem rooted at the migrations for a single database.
+	FS() (fs.FS, error)
+	// String describes the source, for logging and error messages.
+	String() string
+	// DBName identifies which database this source's migrations belong to (eg "main"),
+	// so that Go migrations registered via RegisterMigration only get merged in for the
+	// one database they were written for, not every database this process manages.
+	DBName() string
+}
+
+// dirSource reads migrations from a directory on disk. This is the original, and still the
+// most common, way of pointing 'migrator' at a set of migrations.
+type dirSource struct {
+	path string
+}
+
+func (s *dirSource) FS() (fs.FS, error) { return os.DirFS(s.path), nil }
+func (s *dirSource) String() string     { return s.path }
+func (s *dirSource) DBName() string     { return filepath.Base(s.path) }
+
+// embedSource reads migrations from an embed.FS baked into the binary, rooted at some
+// sub-directory of it (eg a particular database's migrations).
+type embedSource struct {
+	fsys fs.FS
+	root string
+}
+
+func (s *embedSource) FS() (fs.FS, error) {
+	if s.root == "" || s.root == "." {
+		return s.fsys, nil
+	}
+	return fs.Sub(s.fsys, s.root)
+}
+func (s *embedSource) String() string { return "embed://" + s.root }
+func (s *embedSource) DBName() string { return s.root }
+
+// httpTarballSource fetches a gzipped tarball of migrations over HTTP and extracts it into
+// a temp directory the first time FS is called. Useful when the config service hands out a
+// migration bundle, rather than the binary relying on a docker-mounted path.
+type httpTarballSource struct {
+	url string
+	dir string // populated lazily, on first FS() call
+}
+
+func (s *httpTarballSource) String() string { return s.url }
+
+// DBName derives the database name from the tarball's filename (eg
+// "https://.../main.tar.gz" -> "main"), since each bundle is expected to hold exactly one
+// database's migrations.
+func (s *httpTarballSource) DBName() string {
+	name := s.url
+	if idx := strings.LastIndex(name, "/"); idx != -1 {
+		name = name[idx+1:]
+	}
+	name = strings.TrimSuffix(name, ".tar.gz")
+	name = strings.TrimSuffix(name, ".tgz")
+	return name
+}
+
+func (s *httpTarballSource) FS() (fs.FS, error) {
+	if s.dir != "" {
+		return os.DirFS(s.dir), nil
+	}
+	resp, err := http.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch migration bundle from %v: %v", s.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Failed to fetch migration bundle from %v: %v", s.url, resp.Status)
+	}
+	dir, err := os.MkdirTemp("", "migrator-bundle")
+	if err != nil {
+		return nil, err
+	}
+	if err := extractTarGz(resp.Body, dir); err != nil {
+		return nil, err
+	}
+	s.dir = dir
+	return os.DirFS(dir), nil
+}
+
+func extractTarGz(r io.Reader, destDir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destDir, hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			f.Close()
+		}
+	}
+	return nil
+}
+
+// parseMigrationSource interprets a CLI or HTTP-supplied migrations location. A bare
+// filesystem path is treated as a directory on disk (the long-standing behavior);
+// "embed://<name>" selects a sub-directory of the binary's built-in migrations; an
+// "http://" or "https://" URL fetches a tarball.
+func parseMigrationSource(location string) (MigrationSource, error) {
+	switch {
+	case strings.HasPrefix(location, "embed://"):
+		// embeddedMigrations holds the whole dbschema/migrations tree, so re-root it there
+		// before selecting the <name> sub-directory.
+		migrationsFS, err := fs.Sub(embeddedMigrations, "dbschema/migrations")
+		if err != nil {
+			return nil, err
+		}
+		return &embedSource{fsys: migrationsFS, root: strings.TrimPrefix(location, "embed://")}, nil
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return &httpTarballSource{url: location}, nil
+	default:
+		fi, err := os.Stat(location)
+		if err != nil || !fi.IsDir() {
+			return nil, fmt.Errorf("Migration source '%v' is not a directory, embed:// URI, or http(s):// URL", location)
+		}
+		return &dirSource{path: location}, nil
+	}
+}
+
+// discoverMigrations scans a MigrationSource for *.sql files, merges in any Go-coded
+// migrations registered via RegisterMigration, and groups the result by name into a sorted
+// list of migrations. Files following the legacy naming convention (no .up./.down. infix)
+// are treated as up-only.
+func discoverMigrations(src MigrationSource) ([]*migration, error) {
+	fsys, err := src.FS()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*migration{}
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != "." {
+				// Only the root of a migration source is scanned; files in nested
+				// subdirectories (backups, a 'disabled' folder, docs, etc) are
+				// intentionally ignored rather than run as live migrations.
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".sql" {
+			return nil
+		}
+		name, dir, legacy := classifyMigrationFile(path)
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return fmt.Errorf("Error reading migration file %v: %v", path, err)
+		}
+		m := byName[name]
+		if m == nil {
+			m = &migration{Version: name, Legacy: legacy}
+			byName[name] = m
+		}
+		if dir == dirDown {
+			m.DownSQL = content
+		} else {
+			m.UpSQL = content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error scanning migrations from %v: %v", src, err)
+	}
+	dbName := src.DBName()
+	goMigrations := registeredMigrations[dbName]
+	if len(byName) == 0 && len(goMigrations) == 0 {
+		return nil, fmt.Errorf("No SQL files found in %v", src)
+	}
+
+	for name, gm := range goMigrations {
+		m := byName[name]
+		if m == nil {
+			m = &migration{Version: name}
+			byName[name] = m
+		} else if m.UpSQL != nil || m.DownSQL != nil {
+			return nil, fmt.Errorf("Migration %v is registered both as a Go migration (via RegisterMigration) and as a SQL file in %v", name, src)
+		}
+		m.GoUp = gm.Up
+		m.GoDown = gm.Down
+	}
+
+	migrations := make([]*migration, 0, len(byName))
+	for _, m := range byName {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// discoverMigrationsAt is a convenience wrapper that resolves a raw location string (a
+// directory path, embed:// URI, or http(s):// URL) into a MigrationSource and scans it.
+func discoverMigrationsAt(location string) ([]*migration, error) {
+	src, err := parseMigrationSource(location)
+	if err != nil {
+		return nil, err
+	}
+	return discoverMigrations(src)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// mapSource is a MigrationSource backed by an in-memory fstest.MapFS, for tests.
+type mapSource struct {
+	fsys fstest.MapFS
+	db   string
+}
+
+func (s *mapSource) FS() (fs.FS, error) { return s.fsys, nil }
+func (s *mapSource) String() string     { return "test" }
+func (s *mapSource) DBName() string     { return s.db }
+
+// Migrations in a nested subdirectory (eg a 'disabled' folder, or a stray backup copy)
+// must be ignored, not picked up and run as live migrations.
+func TestDiscoverMigrationsIgnoresNestedSubdirectories(t *testing.T) {
+	src := &mapSource{fsys: fstest.MapFS{
+		"0001-initial.up.sql":             {Data: []byte("CREATE TABLE foo (id integer);")},
+		"disabled/0002-skip-me.up.sql":    {Data: []byte("CREATE TABLE bar (id integer);")},
+		"backups/0001-initial.up.sql.bak": {Data: []byte("CREATE TABLE foo (id integer);")},
+	}}
+
+	migrations, err := discoverMigrations(src)
+	if err != nil {
+		t.Fatalf("discoverMigrations: %v", err)
+	}
+	if len(migrations) != 1 {
+		t.Fatalf("expected only the root-level migration to be discovered, got %v", migrations)
+	}
+	if migrations[0].Version != "0001-initial" {
+		t.Errorf("expected version '0001-initial', got %v", migrations[0].Version)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/IMQS/log"
+)
+
+// dollarQuoteTagRe matches a Postgres dollar-quote delimiter, eg '$$' or '$tag$', used to
+// wrap function/trigger bodies so that semicolons inside them aren't statement terminators.
+var dollarQuoteTagRe = regexp.MustCompile(`\$[A-Za-z0-9_]*\$`)
+
+// pgDumpBinary is the pg_dump executable used by 'verify'. It can be overridden for
+// environments where pg_dump isn't on PATH (eg a stripped-down container image).
+var pgDumpBinary = "pg_dump"
+
+func init() {
+	if bin := os.Getenv("MIGRATOR_PG_DUMP_PATH"); bin != "" {
+		pgDumpBinary = bin
+	}
+}
+
+func verifyCmd(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("verify expected at least 3 arguments (logfile, db, sqlDir, [--from <v>]), but %v given", len(args))
+	}
+	logfile := args[0]
+	db := args[1]
+	sqlDir := args[2]
+	fromVersion := ""
+	rest := args[3:]
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == "--from" && i+1 < len(rest) {
+			fromVersion = rest[i+1]
+			i++
+		}
+	}
+	logger := log.New(logfile, true)
+	migrations, err := discoverMigrationsAt(sqlDir)
+	if err != nil {
+		return fmt.Errorf("Error scanning %v: %v", sqlDir, err)
+	}
+	return verify(logger, db, migrations, fromVersion)
+}
+
+// verify checks that migrating a database straight from empty to HEAD produces the same
+// schema as migrating to an earlier revision and then up to HEAD. It does this against two
+// scratch databases, derived from dbStr's target database name, which it drops on exit.
+func verify(logger *log.Logger, dbStr string, migrations []*migration, fromVersion string) error {
+	con, err := parseDBConStr(dbStr)
+	if err != nil {
+		return err
+	}
+
+	if fromVersion == "" {
+		fromVersion, err = latestAppliedVersion(logger, con, migrations)
+		if err != nil {
+			return err
+		}
+	}
+	if fromIndex := indexOfMigration(migrations, fromVersion); fromIndex == -1 {
+		return fmt.Errorf("Unknown migration version '%v'", fromVersion)
+	}
+
+	headCon := con
+	headCon.dbname = con.dbname + "_migrator_verify_head"
+	partialCon := con
+	partialCon.dbname = con.dbname + "_migrator_verify_partial"
+
+	if err := dropDatabaseIfExists(logger, headCon); err != nil {
+		return err
+	}
+	if err := dropDatabaseIfExists(logger, partialCon); err != nil {
+		return err
+	}
+	defer dropDatabaseIfExists(logger, headCon)
+	defer dropDatabaseIfExists(logger, partialCon)
+
+	logger.Infof("Verify: building %v straight to HEAD", headCon.dbname)
+	if err := runMigrations(logger, headCon.dbStr(), migrations, dirUp, 0, false, false); err != nil {
+		return fmt.Errorf("Failed to build HEAD database: %v", err)
+	}
+
+	logger.Infof("Verify: building %v up to %v, then on to HEAD", partialCon.dbname, fromVersion)
+	if err := gotoVersion(logger, partialCon.dbStr(), migrations, fromVersion, false, false); err != nil {
+		return fmt.Errorf("Failed to build partial database at %v: %v", fromVersion, err)
+	}
+	if err := runMigrations(logger, partialCon.dbStr(), migrations, dirUp, 0, false, false); err != nil {
+		return fmt.Errorf("Failed to bring partial database up to HEAD: %v", err)
+	}
+
+	headSchema, err := pgDumpSchema(headCon)
+	if err != nil {
+		return err
+	}
+	partialSchema, err := pgDumpSchema(partialCon)
+	if err != nil {
+		return err
+	}
+
+	normHead := normalizeSchemaDump(headSchema)
+	normPartial := normalizeSchemaDump(partialSchema)
+	if report, ok := diffNormalizedSchemas(normHead, normPartial); !ok {
+		return fmt.Errorf("Schema built straight to HEAD differs from schema built via %v:\n%v", fromVersion, report)
+	}
+
+	logger.Infof("Verify: schemas match (HEAD vs incremental from %v)", fromVersion)
+	fmt.Printf("Schemas match\n")
+	return nil
+}
+
+func indexOfMigration(migrations []*migration, version string) int {
+	for i, m := range migrations {
+		if m.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// latestAppliedVersion inspects a live database (creating it if necessary) and returns the
+// most recently applied migration, for use as the default --from revision.
+func latestAppliedVersion(logger *log.Logger, con dbCon, migrations []*migration) (string, error) {
+	db, err := connectOrCreate(logger, con)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	if err := bootstrap(logger, con.dbname, db, migrations); err != nil {
+		return "", err
+	}
+	existing, err := getMigrationsInDB(db)
+	if err != nil {
+		return "", err
+	}
+	last := ""
+	for _, m := range migrations {
+		if applied(existing, m.Version) {
+			last = m.Version
+		}
+	}
+	if last == "" {
+		return "", fmt.Errorf("Database %v has no applied migrations; specify --from explicitly", con.dbname)
+	}
+	return last, nil
+}
+
+func dropDatabaseIfExists(logger *log.Logger, con dbCon) error {
+	root := con
+	root.dbname = "postgres"
+	db, err := connectOrCreate(logger, root)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %v", con.dbname))
+	return err
+}
+
+// pgDumpSchema shells out to pg_dump to capture the schema-only definition of a database.
+func pgDumpSchema(con dbCon) (string, error) {
+	args := []string{"--schema-only", "--no-owner", "--no-privileges", "-h", con.host, "-U", con.user}
+	if con.port != "" && con.port != "0" {
+		args = append(args, "-p", con.port)
+	}
+	args = append(args, con.dbname)
+
+	cmd := exec.Command(pgDumpBinary, args...)
+	if con.password != "" {
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+con.password)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v --schema-only %v failed: %v: %v", pgDumpBinary, con.dbname, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// normalizeSchemaDump strips comments and dump-session boilerplate from a pg_dump, then
+// sorts the order-independent statements (indexes and constraints) so that two dumps of an
+// identical schema compare equal even if pg_dump happened to emit them in a different order.
+func normalizeSchemaDump(dump string) string {
+	var kept []string
+	for _, line := range strings.Split(dump, "\n") {
+		t := strings.TrimSpace(line)
+		if t == "" || strings.HasPrefix(t, "--") {
+			continue
+		}
+		if strings.HasPrefix(t, "SET ") || strings.HasPrefix(t, "SELECT pg_catalog.set_config") {
+			continue
+		}
+		kept = append(kept, t)
+	}
+
+	// A ';' only ends a statement outside of a dollar-quoted body (eg a CREATE FUNCTION's
+	// "$$ ... $$"), so track whether we're currently inside one, and which tag opened it.
+	var statements []string
+	var cur []string
+	openTag := ""
+	for _, line := range kept {
+		cur = append(cur, line)
+		for _, tag := range dollarQuoteTagRe.FindAllString(line, -1) {
+			if openTag == "" {
+				openTag = tag
+			} else if tag == openTag {
+				openTag = ""
+			}
+		}
+		if openTag == "" && strings.HasSuffix(line, ";") {
+			statements = append(statements, strings.Join(cur, "\n"))
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		statements = append(statements, strings.Join(cur, "\n"))
+	}
+
+	var ordered []string
+	var sortable []string
+	for _, s := range statements {
+		upper := strings.ToUpper(s)
+		isIndex := strings.HasPrefix(upper, "CREATE INDEX") || strings.HasPrefix(upper, "CREATE UNIQUE INDEX")
+		isConstraint := strings.HasPrefix(upper, "ALTER TABLE") && (strings.Contains(upper, "ADD CONSTRAINT") || strings.Contains(upper, "ADD FOREIGN KEY"))
+		if isIndex || isConstraint {
+			sortable = append(sortable, s)
+		} else {
+			ordered = append(ordered, s)
+		}
+	}
+	sort.Strings(sortable)
+	return strings.Join(append(ordered, sortable...), "\n\n")
+}
+
+// diffNormalizedSchemas compares two normalized dumps, and if they differ, returns a
+// human-readable report of which statements are unique to each side.
+func diffNormalizedSchemas(head, partial string) (report string, equal bool) {
+	if head == partial {
+		return "", true
+	}
+
+	headLines := strings.Split(head, "\n\n")
+	partialLines := strings.Split(partial, "\n\n")
+	headSet := map[string]bool{}
+	for _, l := range headLines {
+		headSet[l] = true
+	}
+	partialSet := map[string]bool{}
+	for _, l := range partialLines {
+		partialSet[l] = true
+	}
+
+	var onlyInHead, onlyInPartial []string
+	for _, l := range headLines {
+		if !partialSet[l] {
+			onlyInHead = append(onlyInHead, l)
+		}
+	}
+	for _, l := range partialLines {
+		if !headSet[l] {
+			onlyInPartial = append(onlyInPartial, l)
+		}
+	}
+	sort.Strings(onlyInHead)
+	sort.Strings(onlyInPartial)
+
+	var b strings.Builder
+	if len(onlyInHead) > 0 {
+		fmt.Fprintf(&b, "Only in HEAD-built schema:\n  %v\n", strings.Join(onlyInHead, "\n  "))
+	}
+	if len(onlyInPartial) > 0 {
+		fmt.Fprintf(&b, "Only in incrementally-built schema:\n  %v\n", strings.Join(onlyInPartial, "\n  "))
+	}
+	return b.String(), false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// A CREATE FUNCTION body wrapped in '$$ ... $$' contains its own semicolons; they must not
+// be mistaken for statement terminators (see dollarQuoteTagRe in verify.go).
+func TestNormalizeSchemaDumpDollarQuotedBody(t *testing.T) {
+	dump := `--
+-- PostgreSQL database dump
+--
+SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+CREATE TABLE widgets (
+    id integer NOT NULL
+);
+CREATE FUNCTION widgets_touch() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.updated_at := now();
+    RETURN NEW;
+END;
+$$;
+`
+	got := strings.Split(normalizeSchemaDump(dump), "\n\n")
+	if len(got) != 2 {
+		t.Fatalf("normalizeSchemaDump produced %v statements, want 2:\n%v", len(got), got)
+	}
+	if !strings.HasPrefix(got[0], "CREATE TABLE widgets") && !strings.HasPrefix(got[1], "CREATE TABLE widgets") {
+		t.Errorf("expected one statement to be the CREATE TABLE, got:\n%v", got)
+	}
+	var fn string
+	for _, s := range got {
+		if strings.HasPrefix(s, "CREATE FUNCTION") {
+			fn = s
+		}
+	}
+	if fn == "" {
+		t.Fatalf("expected one statement to be the CREATE FUNCTION, got:\n%v", got)
+	}
+	if strings.Count(fn, ";") < 3 {
+		t.Errorf("expected the function body's internal semicolons to stay part of one statement, got:\n%v", fn)
+	}
+}
+
+func TestDiffNormalizedSchemasEqual(t *testing.T) {
+	a := "CREATE TABLE foo (id integer);"
+	if report, equal := diffNormalizedSchemas(a, a); !equal || report != "" {
+		t.Fatalf("expected identical schemas to compare equal, got equal=%v report=%v", equal, report)
+	}
+}
+
+func TestDiffNormalizedSchemasDiffer(t *testing.T) {
+	head := "CREATE TABLE foo (id integer);\n\nCREATE TABLE bar (id integer);"
+	partial := "CREATE TABLE foo (id integer);"
+	report, equal := diffNormalizedSchemas(head, partial)
+	if equal {
+		t.Fatalf("expected differing schemas to compare unequal")
+	}
+	if !strings.Contains(report, "CREATE TABLE bar (id integer);") {
+		t.Errorf("expected report to mention the missing statement, got:\n%v", report)
+	}
+}